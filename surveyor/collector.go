@@ -0,0 +1,347 @@
+// Copyright 2019 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package surveyor
+
+import (
+	"encoding/json"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const srvPingSubj = "$SYS.REQ.SERVER.PING"
+
+// pollQuiescence is how long poll() waits for one more reply after it has
+// already received at least one, before concluding the deployment has
+// finished answering. It lets a healthy poll finish well inside timeout
+// even when expectedN isn't known yet (e.g. the very first poll).
+const pollQuiescence = 250 * time.Millisecond
+
+// RouteStat is the subset of a route's statz reported by a NATS server.
+type RouteStat struct {
+	ID       uint64 `json:"rid"`
+	Sent     Data   `json:"sent"`
+	Received Data   `json:"received"`
+}
+
+// GatewayStat is the subset of a gateway's statz reported by a NATS server.
+type GatewayStat struct {
+	Name string `json:"name"`
+	ID   uint64 `json:"gwid"`
+	Sent Data   `json:"sent"`
+}
+
+// Data captures a msgs/bytes pair, as reported for routes and gateways.
+type Data struct {
+	Msgs  int64 `json:"msgs"`
+	Bytes int64 `json:"bytes"`
+}
+
+// ServerStat is the subset of a $SYS.REQ.SERVER.PING reply this collector
+// cares about, flattened from the reply's nested "server"/"statsz" pair by
+// UnmarshalJSON for convenience.
+type ServerStat struct {
+	ID       string
+	Cluster  string
+	Host     string
+	Mem      int64
+	CPU      float64
+	Routes   []*RouteStat
+	Gateways []*GatewayStat
+}
+
+// pingReply mirrors the shape of a $SYS.REQ.SERVER.PING reply closely
+// enough to decode the fields ServerStat cares about.
+type pingReply struct {
+	Server struct {
+		ID      string `json:"id"`
+		Host    string `json:"host"`
+		Cluster string `json:"cluster"`
+	} `json:"server"`
+	Statsz struct {
+		Mem      int64          `json:"mem"`
+		CPU      float64        `json:"cpu"`
+		Routes   []*RouteStat   `json:"routes"`
+		Gateways []*GatewayStat `json:"gateways"`
+	} `json:"statsz"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler, flattening a $SYS.REQ.SERVER.PING
+// reply's nested server/statsz pair into ServerStat's fields.
+func (s *ServerStat) UnmarshalJSON(data []byte) error {
+	var r pingReply
+	if err := json.Unmarshal(data, &r); err != nil {
+		return err
+	}
+	s.ID = r.Server.ID
+	s.Cluster = r.Server.Cluster
+	s.Host = r.Server.Host
+	s.Mem = r.Statsz.Mem
+	s.CPU = r.Statsz.CPU
+	s.Routes = r.Statsz.Routes
+	s.Gateways = r.Statsz.Gateways
+	return nil
+}
+
+// statzCollector polls a NATS supercluster's system account for per-server
+// statz and exposes them as Prometheus metrics.
+//
+// Replies are fanned out to a bounded pool of workers as they arrive so
+// that decoding/aggregation of one server's statz can't stall the others,
+// and the replies of the most recent poll that got any are cached, one per
+// server, so that a scrape that lands while a poll is already in flight can
+// be served immediately from that cache instead of blocking on a fresh poll.
+// Only the latest reply per server is kept; earlier replies are not.
+type statzCollector struct {
+	nc      *nats.Conn
+	logger  Logger
+	timeout time.Duration
+	workers int
+
+	up      *prometheus.Desc
+	mem     *prometheus.Desc
+	routeIn *prometheus.Desc
+	gwOut   *prometheus.Desc
+
+	pollDuration prometheus.Histogram
+	pollTimeouts prometheus.Counter
+	expected     *prometheus.Desc
+	received     *prometheus.Desc
+
+	mu        sync.RWMutex
+	lastByID  map[string]*ServerStat
+	expectedN int   // servers that replied to the previous poll; tracks the deployment's current size
+	polling   int32 // atomic: 1 while a poll is in flight
+}
+
+func newStatzCollector(nc *nats.Conn, logger Logger, timeout time.Duration, workers int) *statzCollector {
+	if workers <= 0 {
+		workers = DefaultPollWorkers
+	}
+	labels := []string{"nats_server_id", "nats_server_host", "nats_server_cluster"}
+	return &statzCollector{
+		nc:      nc,
+		logger:  logger,
+		timeout: timeout,
+		workers: workers,
+
+		up: prometheus.NewDesc(
+			"nats_up", "Whether the last scrape of this surveyor succeeded (1) or not (0).", nil, nil),
+		mem: prometheus.NewDesc(
+			"nats_core_mem_bytes", "Memory usage of a NATS server.", labels, nil),
+		routeIn: prometheus.NewDesc(
+			"nats_core_route_recv_msg_count", "Messages received by a route.",
+			append(append([]string{}, labels...), "nats_server_route_id"), nil),
+		gwOut: prometheus.NewDesc(
+			"nats_core_gateway_sent_bytes", "Bytes sent over a gateway.",
+			append(append([]string{}, labels...), "nats_server_gateway_name", "nats_server_gateway_id"), nil),
+
+		pollDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "nats_surveyor_poll_duration_seconds",
+			Help:    "How long a full statz poll of the supercluster took.",
+			Buckets: prometheus.DefBuckets,
+		}),
+		pollTimeouts: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "nats_surveyor_poll_timeouts_total",
+			Help: "Number of servers that did not reply to a statz poll before PollTimeout.",
+		}),
+		expected: prometheus.NewDesc(
+			"nats_surveyor_expected_servers", "Number of servers the surveyor expects to hear from on a poll.", nil, nil),
+		received: prometheus.NewDesc(
+			"nats_surveyor_received_servers", "Number of servers that replied to the most recent poll.", nil, nil),
+
+		lastByID: make(map[string]*ServerStat),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (sc *statzCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- sc.up
+	ch <- sc.mem
+	ch <- sc.routeIn
+	ch <- sc.gwOut
+	ch <- sc.expected
+	ch <- sc.received
+	sc.pollDuration.Describe(ch)
+	sc.pollTimeouts.Describe(ch)
+}
+
+// Collect implements prometheus.Collector. If no poll is currently in
+// flight it triggers one and waits for it to finish (bounded by
+// sc.timeout); otherwise it serves the most recently cached statz so a
+// second concurrent scrape doesn't pile up behind the first.
+func (sc *statzCollector) Collect(ch chan<- prometheus.Metric) {
+	up := float64(1)
+	if !sc.nc.IsConnected() {
+		up = 0
+	} else if atomic.CompareAndSwapInt32(&sc.polling, 0, 1) {
+		defer atomic.StoreInt32(&sc.polling, 0)
+		if received, timedOut := sc.poll(); received == 0 || timedOut > 0 {
+			up = 0
+		}
+	}
+
+	ch <- prometheus.MustNewConstMetric(sc.up, prometheus.GaugeValue, up)
+	ch <- sc.pollDurationMetric()
+	ch <- sc.pollTimeoutsMetric()
+
+	sc.mu.RLock()
+	defer sc.mu.RUnlock()
+	ch <- prometheus.MustNewConstMetric(sc.expected, prometheus.GaugeValue, float64(sc.expectedN))
+	ch <- prometheus.MustNewConstMetric(sc.received, prometheus.GaugeValue, float64(len(sc.lastByID)))
+
+	for _, s := range sc.lastByID {
+		labels := []string{s.ID, s.Host, s.Cluster}
+		ch <- prometheus.MustNewConstMetric(sc.mem, prometheus.GaugeValue, float64(s.Mem), labels...)
+		for _, r := range s.Routes {
+			rl := append(append([]string{}, labels...), fmtID(r.ID))
+			ch <- prometheus.MustNewConstMetric(sc.routeIn, prometheus.CounterValue, float64(r.Received.Msgs), rl...)
+		}
+		for _, g := range s.Gateways {
+			gl := append(append([]string{}, labels...), g.Name, fmtID(g.ID))
+			ch <- prometheus.MustNewConstMetric(sc.gwOut, prometheus.CounterValue, float64(g.Sent.Bytes), gl...)
+		}
+	}
+}
+
+func (sc *statzCollector) pollDurationMetric() prometheus.Metric {
+	m, _ := sc.asMetric(sc.pollDuration)
+	return m
+}
+
+func (sc *statzCollector) pollTimeoutsMetric() prometheus.Metric {
+	m, _ := sc.asMetric(sc.pollTimeouts)
+	return m
+}
+
+func (sc *statzCollector) asMetric(c prometheus.Collector) (prometheus.Metric, bool) {
+	mc := make(chan prometheus.Metric, 1)
+	c.Collect(mc)
+	select {
+	case m := <-mc:
+		return m, true
+	default:
+		return nil, false
+	}
+}
+
+// poll fans the replies to a single broadcast PING out across a bounded
+// pool of workers, each of which decodes a reply into this poll's set of
+// statz as it arrives, before sc.timeout elapsed; once the receive loop
+// ends that set replaces lastByID, unless no server replied. The loop
+// exits early once the number of expected servers (the most recently seen
+// count) has replied, or once pollQuiescence passes without a new reply,
+// rather than always waiting out the full timeout, so a healthy scrape
+// costs roughly the slowest server's RTT instead of a fixed floor. It
+// returns the number of servers that replied, and how many fewer that is
+// than replied to the previous poll (0 if it held steady or grew), so a
+// server dropping out of the deployment shows up as a single timed-out
+// poll rather than a permanent one.
+func (sc *statzCollector) poll() (received, timedOut int) {
+	start := time.Now()
+	defer func() { sc.pollDuration.Observe(time.Since(start).Seconds()) }()
+
+	sc.mu.RLock()
+	expected := sc.expectedN
+	sc.mu.RUnlock()
+
+	inbox := nats.NewInbox()
+	sub, err := sc.nc.SubscribeSync(inbox)
+	if err != nil {
+		sc.logger.Errorf("could not subscribe for statz replies: %v", err)
+		return 0, 0
+	}
+	defer sub.Unsubscribe()
+
+	if err := sc.nc.PublishRequest(srvPingSubj, inbox, nil); err != nil {
+		sc.logger.Errorf("could not publish statz poll: %v", err)
+		return 0, 0
+	}
+	if err := sc.nc.Flush(); err != nil {
+		sc.logger.Errorf("could not flush statz poll: %v", err)
+		return 0, 0
+	}
+
+	jobs := make(chan *nats.Msg, sc.workers)
+	var wg sync.WaitGroup
+	seen := make(map[string]*ServerStat)
+	var seenMu sync.Mutex
+
+	for i := 0; i < sc.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for msg := range jobs {
+				var s ServerStat
+				if err := json.Unmarshal(msg.Data, &s); err != nil {
+					sc.logger.Errorf("could not parse statz reply: %v", err)
+					continue
+				}
+				seenMu.Lock()
+				seen[s.ID] = &s
+				seenMu.Unlock()
+			}
+		}()
+	}
+
+	deadline := time.Now().Add(sc.timeout)
+	replies := 0
+	for {
+		wait := time.Until(deadline)
+		if wait <= 0 {
+			break
+		}
+		if replies > 0 && wait > pollQuiescence {
+			wait = pollQuiescence
+		}
+		msg, err := sub.NextMsg(wait)
+		if err != nil {
+			// Once we've heard from at least one server, treat a lull as
+			// the rest of the deployment having finished answering rather
+			// than waiting out the full timeout.
+			break
+		}
+		jobs <- msg
+		replies++
+		if expected > 0 && replies >= expected {
+			break
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	sc.mu.Lock()
+	if d := sc.expectedN - len(seen); d > 0 {
+		timedOut = d
+	}
+	if len(seen) > 0 {
+		sc.lastByID = seen
+		sc.expectedN = len(seen)
+	}
+	sc.mu.Unlock()
+
+	if timedOut > 0 {
+		sc.pollTimeouts.Add(float64(timedOut))
+	}
+
+	return len(seen), timedOut
+}
+
+func fmtID(id uint64) string {
+	return strconv.FormatUint(id, 10)
+}
@@ -0,0 +1,49 @@
+// Copyright 2019 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package surveyor
+
+import "fmt"
+
+// ExporterMode selects how collected statz are made available.
+type ExporterMode string
+
+// Supported ExporterMode values.
+const (
+	// ExporterPrometheus exposes statz on the HTTP(S) /metrics endpoint
+	// for Prometheus (or a compatible scraper) to pull. This is the
+	// default and matches the surveyor's historical behavior.
+	ExporterPrometheus ExporterMode = "prometheus"
+	// ExporterOTLP pushes statz as OTLP metrics to Options.OTLPEndpoint
+	// on Options.OTLPInterval, instead of serving /metrics.
+	ExporterOTLP ExporterMode = "otlp"
+	// ExporterBoth runs both of the above at once.
+	ExporterBoth ExporterMode = "both"
+)
+
+func (m ExporterMode) servesPrometheus() bool {
+	return m == "" || m == ExporterPrometheus || m == ExporterBoth
+}
+
+func (m ExporterMode) pushesOTLP() bool {
+	return m == ExporterOTLP || m == ExporterBoth
+}
+
+func (m ExporterMode) validate() error {
+	switch m {
+	case "", ExporterPrometheus, ExporterOTLP, ExporterBoth:
+		return nil
+	default:
+		return fmt.Errorf("unknown exporter mode %q", m)
+	}
+}
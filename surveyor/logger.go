@@ -0,0 +1,46 @@
+// Copyright 2019 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package surveyor
+
+import (
+	"log"
+	"os"
+)
+
+// Logger is the logging interface used throughout the surveyor package.
+type Logger interface {
+	Noticef(format string, v ...interface{})
+	Errorf(format string, v ...interface{})
+	Debugf(format string, v ...interface{})
+}
+
+type defaultLogger struct {
+	l *log.Logger
+}
+
+func newDefaultLogger() *defaultLogger {
+	return &defaultLogger{l: log.New(os.Stderr, "[surveyor] ", log.LstdFlags)}
+}
+
+func (d *defaultLogger) Noticef(format string, v ...interface{}) {
+	d.l.Printf("[INFO] "+format, v...)
+}
+
+func (d *defaultLogger) Errorf(format string, v ...interface{}) {
+	d.l.Printf("[ERROR] "+format, v...)
+}
+
+func (d *defaultLogger) Debugf(format string, v ...interface{}) {
+	d.l.Printf("[DEBUG] "+format, v...)
+}
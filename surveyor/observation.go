@@ -0,0 +1,108 @@
+// Copyright 2019 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package surveyor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/hcl"
+	"github.com/nats-io/nats.go"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Observation is a pluggable source of Prometheus metrics beyond the core
+// NATS server statz polled by the statzCollector. Typical observations
+// subscribe to, or periodically request, a subject scoped to a single
+// account (JetStream stream/consumer info, service-latency samples,
+// account connz, ...).
+type Observation interface {
+	// Start begins observing nc, registering any metrics it owns into reg.
+	// It must not block.
+	Start(nc *nats.Conn, reg prometheus.Registerer) error
+	// Stop stops observing. The metrics Start registered stay registered
+	// in reg.
+	Stop()
+}
+
+// ObservationConfig is the on-disk shape of a single observation config
+// file, one of which is loaded per file in Options.ObservationConfigDir.
+type ObservationConfig struct {
+	Type    string `json:"type" hcl:"type"`
+	Name    string `json:"name" hcl:"name"`
+	Subject string `json:"subject,omitempty" hcl:"subject"`
+
+	// Account is the account to report on. Required when Type is "jetstream"
+	// or "connz", both of which are fetched from the system account on
+	// another account's behalf.
+	Account string `json:"account,omitempty" hcl:"account"`
+}
+
+// NewObservationFromConfig builds the Observation described by cfg.
+func NewObservationFromConfig(cfg *ObservationConfig) (Observation, error) {
+	switch cfg.Type {
+	case "service-latency":
+		return newServiceLatencyObservation(cfg), nil
+	case "jetstream":
+		if cfg.Account == "" {
+			return nil, fmt.Errorf("observation %q: jetstream requires account", cfg.Name)
+		}
+		return newJetStreamObservation(cfg), nil
+	case "connz":
+		if cfg.Account == "" {
+			return nil, fmt.Errorf("observation %q: connz requires account", cfg.Name)
+		}
+		return newConnzObservation(cfg), nil
+	default:
+		return nil, fmt.Errorf("unknown observation type %q in %q", cfg.Type, cfg.Name)
+	}
+}
+
+// LoadObservationConfigs reads one ObservationConfig per *.json or *.hcl
+// file in dir.
+func LoadObservationConfigs(dir string) ([]*ObservationConfig, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("could not read observation config dir %q: %v", dir, err)
+	}
+
+	var configs []*ObservationConfig
+	for _, e := range entries {
+		ext := filepath.Ext(e.Name())
+		if e.IsDir() || (ext != ".json" && ext != ".hcl") {
+			continue
+		}
+		path := filepath.Join(dir, e.Name())
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("could not read observation config %q: %v", path, err)
+		}
+		var cfg ObservationConfig
+		if ext == ".hcl" {
+			if err := hcl.Unmarshal(data, &cfg); err != nil {
+				return nil, fmt.Errorf("could not parse observation config %q: %v", path, err)
+			}
+		} else if err := json.Unmarshal(data, &cfg); err != nil {
+			return nil, fmt.Errorf("could not parse observation config %q: %v", path, err)
+		}
+		if cfg.Name == "" {
+			cfg.Name = strings.TrimSuffix(e.Name(), ext)
+		}
+		configs = append(configs, &cfg)
+	}
+	return configs, nil
+}
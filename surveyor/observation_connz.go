@@ -0,0 +1,102 @@
+// Copyright 2019 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package surveyor
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	connzReqSubjFmt   = "$SYS.REQ.ACCOUNT.%s.CONNZ"
+	connzPollInterval = 30 * time.Second
+)
+
+type connzResponse struct {
+	Data struct {
+		NumConns int `json:"num_connections"`
+	} `json:"data"`
+}
+
+// connzObservation periodically requests an account's connz from the
+// system account and exposes its current connection count.
+type connzObservation struct {
+	name    string
+	account string
+
+	nc    *nats.Conn
+	conns prometheus.Gauge
+
+	stop chan struct{}
+}
+
+func newConnzObservation(cfg *ObservationConfig) *connzObservation {
+	return &connzObservation{name: cfg.Name, account: cfg.Account, stop: make(chan struct{})}
+}
+
+// Start implements Observation.
+func (o *connzObservation) Start(nc *nats.Conn, reg prometheus.Registerer) error {
+	o.nc = nc
+	o.conns = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "nats_account_connections",
+		Help: "Number of active client connections on an account, as reported by connz.",
+		ConstLabels: prometheus.Labels{
+			"observation": o.name,
+			"account":     o.account,
+		},
+	})
+	if err := reg.Register(o.conns); err != nil {
+		return err
+	}
+
+	go o.pollLoop()
+	return nil
+}
+
+func (o *connzObservation) pollLoop() {
+	ticker := time.NewTicker(connzPollInterval)
+	defer ticker.Stop()
+
+	o.poll()
+	for {
+		select {
+		case <-o.stop:
+			return
+		case <-ticker.C:
+			o.poll()
+		}
+	}
+}
+
+func (o *connzObservation) poll() {
+	subject := fmt.Sprintf(connzReqSubjFmt, o.account)
+	msg, err := o.nc.Request(subject, nil, DefaultPollTimeout)
+	if err != nil {
+		return
+	}
+	var resp connzResponse
+	if err := json.Unmarshal(msg.Data, &resp); err != nil {
+		return
+	}
+	o.conns.Set(float64(resp.Data.NumConns))
+}
+
+// Stop implements Observation.
+func (o *connzObservation) Stop() {
+	close(o.stop)
+}
@@ -0,0 +1,144 @@
+// Copyright 2019 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package surveyor
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// jszReqSubjFmt mirrors connzReqSubjFmt: JetStream can't be enabled on
+	// the system account itself, so stream stats for an account have to be
+	// fetched the same way connz is, via a system-account JSZ request
+	// rather than that account's own $JS.API.
+	jszReqSubjFmt  = "$SYS.REQ.ACCOUNT.%s.JSZ"
+	jsPollInterval = 30 * time.Second
+)
+
+type jszRequest struct {
+	Streams bool `json:"streams"`
+}
+
+type jszResponse struct {
+	Data struct {
+		StreamDetail []struct {
+			Name  string `json:"name"`
+			State struct {
+				Messages uint64 `json:"messages"`
+				Bytes    uint64 `json:"bytes"`
+			} `json:"state"`
+		} `json:"stream_detail"`
+	} `json:"data"`
+}
+
+// jetStreamObservation periodically requests an account's JetStream stream
+// stats from the system account and exposes per-stream message/byte counts.
+type jetStreamObservation struct {
+	name    string
+	account string
+
+	nc       *nats.Conn
+	messages *prometheus.GaugeVec
+	bytes    *prometheus.GaugeVec
+
+	// prevStreams is the set of stream names seen on the last poll, so a
+	// stream that disappears (deleted, renamed) between polls has its
+	// series removed instead of going stale forever.
+	prevStreams map[string]bool
+
+	stop chan struct{}
+}
+
+func newJetStreamObservation(cfg *ObservationConfig) *jetStreamObservation {
+	return &jetStreamObservation{name: cfg.Name, account: cfg.Account, stop: make(chan struct{})}
+}
+
+// Start implements Observation.
+func (o *jetStreamObservation) Start(nc *nats.Conn, reg prometheus.Registerer) error {
+	o.nc = nc
+	labels := []string{"observation", "stream"}
+	o.messages = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "nats_stream_messages",
+		Help: "Number of messages currently retained by a JetStream stream.",
+	}, labels)
+	o.bytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "nats_stream_bytes",
+		Help: "Number of bytes currently retained by a JetStream stream.",
+	}, labels)
+	if err := reg.Register(o.messages); err != nil {
+		return err
+	}
+	if err := reg.Register(o.bytes); err != nil {
+		reg.Unregister(o.messages)
+		return err
+	}
+
+	go o.pollLoop()
+	return nil
+}
+
+func (o *jetStreamObservation) pollLoop() {
+	ticker := time.NewTicker(jsPollInterval)
+	defer ticker.Stop()
+
+	o.poll()
+	for {
+		select {
+		case <-o.stop:
+			return
+		case <-ticker.C:
+			o.poll()
+		}
+	}
+}
+
+func (o *jetStreamObservation) poll() {
+	subject := fmt.Sprintf(jszReqSubjFmt, o.account)
+	req, err := json.Marshal(jszRequest{Streams: true})
+	if err != nil {
+		return
+	}
+	msg, err := o.nc.Request(subject, req, DefaultPollTimeout)
+	if err != nil {
+		return
+	}
+	var resp jszResponse
+	if err := json.Unmarshal(msg.Data, &resp); err != nil {
+		return
+	}
+
+	seen := make(map[string]bool, len(resp.Data.StreamDetail))
+	for _, sd := range resp.Data.StreamDetail {
+		seen[sd.Name] = true
+		o.messages.WithLabelValues(o.name, sd.Name).Set(float64(sd.State.Messages))
+		o.bytes.WithLabelValues(o.name, sd.Name).Set(float64(sd.State.Bytes))
+	}
+	for name := range o.prevStreams {
+		if !seen[name] {
+			o.messages.DeleteLabelValues(o.name, name)
+			o.bytes.DeleteLabelValues(o.name, name)
+		}
+	}
+	o.prevStreams = seen
+}
+
+// Stop implements Observation.
+func (o *jetStreamObservation) Stop() {
+	close(o.stop)
+}
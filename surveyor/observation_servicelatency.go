@@ -0,0 +1,86 @@
+// Copyright 2019 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package surveyor
+
+import (
+	"encoding/json"
+
+	"github.com/nats-io/nats.go"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// defaultLatencySubject is subscribed to when an ObservationConfig of type
+// "service-latency" does not specify one, matching the subject a NATS
+// account's service export latency tracking publishes to.
+const defaultLatencySubject = "$SRV.LATENCY.>"
+
+// serviceLatencyMetric is the subset of the NATS server's service-latency
+// advisory payload this observation cares about.
+type serviceLatencyMetric struct {
+	AppName        string  `json:"app,omitempty"`
+	RequestStart   string  `json:"start"`
+	TotalLatencyMs float64 `json:"total_latency"`
+}
+
+// serviceLatencyObservation subscribes to a service's latency advisory
+// subject and exposes the reported end-to-end latency as a histogram.
+type serviceLatencyObservation struct {
+	name    string
+	subject string
+
+	sub  *nats.Subscription
+	hist *prometheus.HistogramVec
+}
+
+func newServiceLatencyObservation(cfg *ObservationConfig) *serviceLatencyObservation {
+	subject := cfg.Subject
+	if subject == "" {
+		subject = defaultLatencySubject
+	}
+	return &serviceLatencyObservation{name: cfg.Name, subject: subject}
+}
+
+// Start implements Observation.
+func (o *serviceLatencyObservation) Start(nc *nats.Conn, reg prometheus.Registerer) error {
+	o.hist = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "nats_service_latency_duration_seconds",
+		Help: "End-to-end latency reported by a NATS service export, as observed on its latency advisory subject.",
+	}, []string{"observation", "app"})
+	if err := reg.Register(o.hist); err != nil {
+		return err
+	}
+
+	sub, err := nc.Subscribe(o.subject, o.handle)
+	if err != nil {
+		reg.Unregister(o.hist)
+		return err
+	}
+	o.sub = sub
+	return nil
+}
+
+func (o *serviceLatencyObservation) handle(msg *nats.Msg) {
+	var m serviceLatencyMetric
+	if err := json.Unmarshal(msg.Data, &m); err != nil {
+		return
+	}
+	o.hist.WithLabelValues(o.name, m.AppName).Observe(m.TotalLatencyMs / 1000.0)
+}
+
+// Stop implements Observation.
+func (o *serviceLatencyObservation) Stop() {
+	if o.sub != nil {
+		_ = o.sub.Unsubscribe()
+	}
+}
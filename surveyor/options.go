@@ -0,0 +1,96 @@
+// Copyright 2019 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package surveyor
+
+import "time"
+
+// Defaults for listen address, polling, etc.
+const (
+	DefaultListenAddress = "0.0.0.0"
+	DefaultListenPort    = 7777
+	DefaultURL           = "nats://127.0.0.1:4222"
+	DefaultPollTimeout   = 3 * time.Second
+	DefaultOTLPInterval  = 15 * time.Second
+	DefaultPollWorkers   = 10
+)
+
+// Options are the options for a Surveyor.
+type Options struct {
+	URLs          string
+	Credentials   string
+	NatsUser      string
+	NatsPassword  string
+	ListenAddress string
+	ListenPort    int
+	HTTPUser      string
+	HTTPPassword  string
+	CertFile      string
+	KeyFile       string
+
+	// CaFile is deprecated in favor of ClientCAFiles. If ClientCAFiles is
+	// empty, CaFile (when set) is treated as its sole entry.
+	CaFile string
+
+	// ClientCAFiles verify incoming Prometheus scrapers on the HTTPS
+	// listener (tls.Config.ClientCAs, ClientAuth ==
+	// RequireAndVerifyClientCert). Each entry may be a PEM file or a
+	// directory of PEM files, so cross-signed roots and staged CA
+	// migrations can be rolled out without downtime.
+	ClientCAFiles []string
+
+	// RootCAFiles verify the NATS server(s) the surveyor connects to as
+	// the system account. Each entry may be a PEM file or a directory of
+	// PEM files.
+	RootCAFiles []string
+
+	PollTimeout time.Duration
+	// PollWorkers bounds how many statz replies are decoded and merged
+	// concurrently during a single poll. Defaults to DefaultPollWorkers.
+	PollWorkers int
+	Logger      Logger
+
+	// ObservationConfigDir, if set, is read at startup for one
+	// ObservationConfig JSON or HCL file per pluggable observation to run
+	// alongside the core statz collector (see Observation).
+	ObservationConfigDir string
+
+	// Observations are additional observations to start alongside any
+	// loaded from ObservationConfigDir, e.g. for use from tests that
+	// construct one in process.
+	Observations []Observation
+
+	// Exporter selects how collected statz are made available: on the
+	// Prometheus /metrics endpoint (the default), pushed as OTLP metrics,
+	// or both. See ExporterMode.
+	Exporter ExporterMode
+	// OTLPEndpoint is the OTLP/gRPC collector endpoint statz are pushed
+	// to when Exporter is ExporterOTLP or ExporterBoth.
+	OTLPEndpoint string
+	// OTLPInterval is how often statz are pushed to OTLPEndpoint.
+	OTLPInterval time.Duration
+}
+
+// GetDefaultOptions returns the default set of options for a Surveyor.
+func GetDefaultOptions() *Options {
+	return &Options{
+		URLs:          DefaultURL,
+		ListenAddress: DefaultListenAddress,
+		ListenPort:    DefaultListenPort,
+		PollTimeout:   DefaultPollTimeout,
+		PollWorkers:   DefaultPollWorkers,
+		Logger:        newDefaultLogger(),
+		Exporter:      ExporterPrometheus,
+		OTLPInterval:  DefaultOTLPInterval,
+	}
+}
@@ -0,0 +1,206 @@
+// Copyright 2019 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package surveyor
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/resource"
+)
+
+// otlpExporter periodically gathers the surveyor's Prometheus registry and
+// pushes the result as OTLP metrics, so deployments that centralize on an
+// OpenTelemetry collector don't need to also run a Prometheus scraper.
+type otlpExporter struct {
+	registry *prometheus.Registry
+	exporter *otlpmetricgrpc.Exporter
+	interval time.Duration
+	logger   Logger
+
+	stop chan struct{}
+}
+
+func newOTLPExporter(o *Options, registry *prometheus.Registry) (*otlpExporter, error) {
+	if o.OTLPEndpoint == "" {
+		return nil, fmt.Errorf("OTLPEndpoint is required when Exporter is %q", o.Exporter)
+	}
+
+	exp, err := otlpmetricgrpc.New(context.Background(),
+		otlpmetricgrpc.WithEndpoint(o.OTLPEndpoint),
+		otlpmetricgrpc.WithInsecure(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("could not create OTLP exporter: %v", err)
+	}
+
+	interval := o.OTLPInterval
+	if interval <= 0 {
+		interval = DefaultOTLPInterval
+	}
+
+	return &otlpExporter{
+		registry: registry,
+		exporter: exp,
+		interval: interval,
+		logger:   o.Logger,
+		stop:     make(chan struct{}),
+	}, nil
+}
+
+func (e *otlpExporter) start() {
+	go func() {
+		ticker := time.NewTicker(e.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-e.stop:
+				return
+			case <-ticker.C:
+				if err := e.pushOnce(); err != nil {
+					e.logger.Errorf("OTLP export failed: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+func (e *otlpExporter) pushOnce() error {
+	families, err := e.registry.Gather()
+	if err != nil {
+		return err
+	}
+
+	rm := &metricdata.ResourceMetrics{
+		Resource: resource.Default(),
+		ScopeMetrics: []metricdata.ScopeMetrics{
+			{
+				Scope:   instrumentation.Scope{Name: "github.com/nats-io/nats-surveyor"},
+				Metrics: translateMetricFamilies(families),
+			},
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), e.interval)
+	defer cancel()
+	return e.exporter.Export(ctx, rm)
+}
+
+// translateMetricFamilies converts gathered Prometheus metric families into
+// OTel Metrics, carrying the Prometheus label names/values over verbatim as
+// OTel attributes so dashboards built against the nats_core_* names and
+// nats_server_host/cluster/... attribute keys keep working either way.
+func translateMetricFamilies(families []*dto.MetricFamily) []metricdata.Metrics {
+	out := make([]metricdata.Metrics, 0, len(families))
+	for _, mf := range families {
+		switch mf.GetType() {
+		case dto.MetricType_COUNTER:
+			out = append(out, metricdata.Metrics{
+				Name: mf.GetName(),
+				Data: metricdata.Sum[float64]{
+					DataPoints:  counterDataPoints(mf),
+					Temporality: metricdata.CumulativeTemporality,
+					IsMonotonic: true,
+				},
+			})
+		case dto.MetricType_HISTOGRAM:
+			out = append(out, metricdata.Metrics{
+				Name: mf.GetName(),
+				Data: metricdata.Histogram[float64]{
+					DataPoints:  histogramDataPoints(mf),
+					Temporality: metricdata.CumulativeTemporality,
+				},
+			})
+		default: // GAUGE and anything else we don't special-case is exported as a gauge
+			out = append(out, metricdata.Metrics{
+				Name: mf.GetName(),
+				Data: metricdata.Gauge[float64]{
+					DataPoints: gaugeDataPoints(mf),
+				},
+			})
+		}
+	}
+	return out
+}
+
+func counterDataPoints(mf *dto.MetricFamily) []metricdata.DataPoint[float64] {
+	points := make([]metricdata.DataPoint[float64], 0, len(mf.GetMetric()))
+	for _, m := range mf.GetMetric() {
+		points = append(points, metricdata.DataPoint[float64]{
+			Attributes: attributesFromLabels(m.GetLabel()),
+			Value:      m.GetCounter().GetValue(),
+		})
+	}
+	return points
+}
+
+func histogramDataPoints(mf *dto.MetricFamily) []metricdata.HistogramDataPoint[float64] {
+	points := make([]metricdata.HistogramDataPoint[float64], 0, len(mf.GetMetric()))
+	for _, m := range mf.GetMetric() {
+		h := m.GetHistogram()
+		buckets := h.GetBucket()
+		bounds := make([]float64, len(buckets))
+		counts := make([]uint64, len(buckets)+1)
+		var cumulative uint64
+		for i, b := range buckets {
+			bounds[i] = b.GetUpperBound()
+			counts[i] = b.GetCumulativeCount() - cumulative
+			cumulative = b.GetCumulativeCount()
+		}
+		counts[len(buckets)] = h.GetSampleCount() - cumulative
+
+		points = append(points, metricdata.HistogramDataPoint[float64]{
+			Attributes:   attributesFromLabels(m.GetLabel()),
+			Count:        h.GetSampleCount(),
+			Bounds:       bounds,
+			BucketCounts: counts,
+			Sum:          h.GetSampleSum(),
+		})
+	}
+	return points
+}
+
+func gaugeDataPoints(mf *dto.MetricFamily) []metricdata.DataPoint[float64] {
+	points := make([]metricdata.DataPoint[float64], 0, len(mf.GetMetric()))
+	for _, m := range mf.GetMetric() {
+		points = append(points, metricdata.DataPoint[float64]{
+			Attributes: attributesFromLabels(m.GetLabel()),
+			Value:      m.GetGauge().GetValue(),
+		})
+	}
+	return points
+}
+
+func attributesFromLabels(labels []*dto.LabelPair) attribute.Set {
+	kvs := make([]attribute.KeyValue, 0, len(labels))
+	for _, l := range labels {
+		kvs = append(kvs, attribute.String(l.GetName(), l.GetValue()))
+	}
+	return attribute.NewSet(kvs...)
+}
+
+// close shuts down the OTLP exporter, flushing any pending export.
+func (e *otlpExporter) close() {
+	close(e.stop)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_ = e.exporter.Shutdown(ctx)
+}
@@ -0,0 +1,112 @@
+// Copyright 2019 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package surveyor
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	colmetricpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	metricpb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/grpc"
+
+	st "github.com/nats-io/nats-surveyor/test"
+)
+
+// fakeOTLPCollector is a minimal in-process OTLP/gRPC metrics receiver used
+// to assert the surveyor pushes statz when Options.Exporter is ExporterOTLP.
+type fakeOTLPCollector struct {
+	colmetricpb.UnimplementedMetricsServiceServer
+	requests chan *colmetricpb.ExportMetricsServiceRequest
+}
+
+func (c *fakeOTLPCollector) Export(ctx context.Context, req *colmetricpb.ExportMetricsServiceRequest) (*colmetricpb.ExportMetricsServiceResponse, error) {
+	c.requests <- req
+	return &colmetricpb.ExportMetricsServiceResponse{}, nil
+}
+
+func startFakeOTLPCollector(t *testing.T) (addr string, collector *fakeOTLPCollector, stop func()) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("couldn't listen: %v", err)
+	}
+
+	collector = &fakeOTLPCollector{requests: make(chan *colmetricpb.ExportMetricsServiceRequest, 16)}
+	srv := grpc.NewServer()
+	colmetricpb.RegisterMetricsServiceServer(srv, collector)
+	go srv.Serve(ln)
+
+	return ln.Addr().String(), collector, srv.Stop
+}
+
+func TestSurveyor_OTLPExporter(t *testing.T) {
+	sc := st.NewSuperCluster(t)
+	defer sc.Shutdown()
+
+	addr, collector, stopCollector := startFakeOTLPCollector(t)
+	defer stopCollector()
+
+	opts := getTestOptions()
+	opts.Exporter = ExporterOTLP
+	opts.OTLPEndpoint = addr
+	opts.OTLPInterval = 200 * time.Millisecond
+
+	s, err := NewSurveyor(opts)
+	if err != nil {
+		t.Fatalf("couldn't create surveyor: %v", err)
+	}
+	if err = s.Start(); err != nil {
+		t.Fatalf("start error: %v", err)
+	}
+	defer s.Stop()
+
+	deadline := time.After(5 * time.Second)
+	for {
+		select {
+		case req := <-collector.requests:
+			if len(req.ResourceMetrics) == 0 {
+				t.Fatalf("expected at least one resource metrics entry")
+			}
+			if hist := findMetric(req, "nats_surveyor_poll_duration_seconds"); hist != nil {
+				dps := hist.GetHistogram().GetDataPoints()
+				if len(dps) == 0 {
+					t.Fatalf("expected at least one poll duration histogram data point")
+				}
+				if dps[0].GetCount() == 0 {
+					t.Fatalf("expected poll duration histogram to have a non-zero count, got %+v", dps[0])
+				}
+				return
+			}
+		case <-deadline:
+			t.Fatalf("timed out waiting for the poll duration histogram to be exported")
+		}
+	}
+}
+
+func findMetric(req *colmetricpb.ExportMetricsServiceRequest, name string) *metricpb.Metric {
+	for _, rm := range req.ResourceMetrics {
+		for _, sm := range rm.ScopeMetrics {
+			for _, m := range sm.Metrics {
+				if m.GetName() == name {
+					return m
+				}
+			}
+		}
+	}
+	return nil
+}
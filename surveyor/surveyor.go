@@ -0,0 +1,297 @@
+// Copyright 2019 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package surveyor is used to garner data from a NATS deployment for Prometheus
+package surveyor
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/nats-io/nats.go"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Surveyor polls a NATS deployment's system account and makes the resulting
+// statz available as Prometheus metrics on an HTTP(S) endpoint, as pushed
+// OTLP metrics, or both, as Options.Exporter selects.
+type Surveyor struct {
+	opts         *Options
+	nc           *nats.Conn
+	registry     *prometheus.Registry
+	collector    *statzCollector
+	http         *http.Server
+	tls          *tlsReloader
+	observations []Observation
+	otlp         *otlpExporter
+}
+
+// NewSurveyor creates a new Surveyor, connecting to the configured NATS
+// system account. The returned Surveyor has not started listening yet;
+// call Start to do so.
+func NewSurveyor(o *Options) (*Surveyor, error) {
+	if o == nil {
+		o = GetDefaultOptions()
+	}
+	if o.Logger == nil {
+		o.Logger = newDefaultLogger()
+	}
+	if err := o.Exporter.validate(); err != nil {
+		return nil, err
+	}
+
+	nopts := []nats.Option{nats.Name("nats-surveyor")}
+	if o.Credentials != "" {
+		nopts = append(nopts, nats.UserCredentials(o.Credentials))
+	}
+	if o.NatsUser != "" {
+		nopts = append(nopts, nats.UserInfo(o.NatsUser, o.NatsPassword))
+	}
+	if len(o.RootCAFiles) > 0 {
+		rootFiles, err := expandCAPaths(o.RootCAFiles)
+		if err != nil {
+			return nil, err
+		}
+		nopts = append(nopts, nats.RootCAs(rootFiles...))
+	}
+
+	nc, err := nats.Connect(o.URLs, nopts...)
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to NATS: %v", err)
+	}
+
+	registry := prometheus.NewRegistry()
+	collector := newStatzCollector(nc, o.Logger, o.PollTimeout, o.PollWorkers)
+	registry.MustRegister(collector)
+
+	s := &Surveyor{
+		opts:      o,
+		nc:        nc,
+		registry:  registry,
+		collector: collector,
+	}
+
+	if o.Exporter.servesPrometheus() {
+		s.http, err = s.newHTTPServer()
+		if err != nil {
+			nc.Close()
+			return nil, err
+		}
+	}
+	if o.Exporter.pushesOTLP() {
+		s.otlp, err = newOTLPExporter(o, registry)
+		if err != nil {
+			nc.Close()
+			return nil, err
+		}
+	}
+
+	s.observations = append(s.observations, o.Observations...)
+	if o.ObservationConfigDir != "" {
+		configs, err := LoadObservationConfigs(o.ObservationConfigDir)
+		if err != nil {
+			nc.Close()
+			return nil, err
+		}
+		for _, cfg := range configs {
+			obs, err := NewObservationFromConfig(cfg)
+			if err != nil {
+				nc.Close()
+				return nil, err
+			}
+			s.observations = append(s.observations, obs)
+		}
+	}
+
+	return s, nil
+}
+
+func (s *Surveyor) newHTTPServer() (*http.Server, error) {
+	o := s.opts
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", s.basicAuthHandler(promhttp.HandlerFor(s.registry, promhttp.HandlerOpts{})))
+
+	server := &http.Server{
+		Addr:    fmt.Sprintf("%s:%d", o.ListenAddress, o.ListenPort),
+		Handler: mux,
+	}
+
+	if o.CertFile != "" {
+		reloader, err := newTLSReloader(o, o.Logger)
+		if err != nil {
+			return nil, err
+		}
+		s.tls = reloader
+		s.registry.MustRegister(reloader.expiry)
+
+		// GetConfigForClient is consulted on every handshake, so the
+		// keypair and client CA pool swapped in by ReloadTLS (or the
+		// fsnotify watch) take effect without restarting the listener.
+		server.TLSConfig = &tls.Config{
+			MinVersion:         tls.VersionTLS12,
+			GetConfigForClient: reloader.GetConfigForClient,
+		}
+	}
+
+	return server, nil
+}
+
+// expandCAPaths turns a list of CA paths, each of which may be a PEM file
+// or a directory of PEM files, into a flat list of file paths.
+func expandCAPaths(paths []string) ([]string, error) {
+	var files []string
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			return nil, fmt.Errorf("could not stat CA path %q: %v", p, err)
+		}
+		if !info.IsDir() {
+			files = append(files, p)
+			continue
+		}
+		entries, err := ioutil.ReadDir(p)
+		if err != nil {
+			return nil, fmt.Errorf("could not read CA directory %q: %v", p, err)
+		}
+		for _, e := range entries {
+			if !e.IsDir() {
+				files = append(files, filepath.Join(p, e.Name()))
+			}
+		}
+	}
+	return files, nil
+}
+
+// loadCertPoolFromFiles builds a CertPool by concatenating the PEM data
+// from every file in paths, where each entry may itself be a directory of
+// PEM files. This lets cross-signed roots and staged CA migrations be
+// expressed as multiple files without the caller having to cat them
+// together by hand.
+func loadCertPoolFromFiles(paths []string) (*x509.CertPool, error) {
+	files, err := expandCAPaths(paths)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	var added bool
+	for _, f := range files {
+		pem, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("could not read CA file %q: %v", f, err)
+		}
+		if pool.AppendCertsFromPEM(pem) {
+			added = true
+		}
+	}
+	if !added {
+		return nil, fmt.Errorf("no certificates found in %v", paths)
+	}
+	return pool, nil
+}
+
+func (s *Surveyor) basicAuthHandler(next http.Handler) http.Handler {
+	o := s.opts
+	if o.HTTPUser == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok ||
+			subtle.ConstantTimeCompare([]byte(user), []byte(o.HTTPUser)) != 1 ||
+			subtle.ConstantTimeCompare([]byte(pass), []byte(o.HTTPPassword)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="nats-surveyor"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Start starts the pluggable observations (if any), begins listening for
+// Prometheus scrape requests (if Options.Exporter serves Prometheus), and
+// begins pushing OTLP metrics on an interval (if Options.Exporter pushes
+// OTLP).
+func (s *Surveyor) Start() error {
+	for _, obs := range s.observations {
+		if err := obs.Start(s.nc, s.registry); err != nil {
+			return fmt.Errorf("could not start observation: %v", err)
+		}
+	}
+
+	if s.otlp != nil {
+		s.otlp.start()
+	}
+
+	if s.http == nil {
+		return nil
+	}
+
+	ln, err := net.Listen("tcp", s.http.Addr)
+	if err != nil {
+		return fmt.Errorf("could not listen on %q: %v", s.http.Addr, err)
+	}
+
+	go func() {
+		var err error
+		if s.http.TLSConfig != nil {
+			err = s.http.ServeTLS(ln, s.opts.CertFile, s.opts.KeyFile)
+		} else {
+			err = s.http.Serve(ln)
+		}
+		if err != nil && err != http.ErrServerClosed {
+			s.opts.Logger.Errorf("HTTP server error: %v", err)
+		}
+	}()
+	return nil
+}
+
+// ReloadTLS re-reads the HTTPS server's keypair and CA bundle from disk and
+// swaps them into the running listener. Surveyor also does this
+// automatically via fsnotify when those files change, so most deployments
+// won't need to call it directly.
+func (s *Surveyor) ReloadTLS() error {
+	if s.tls == nil {
+		return fmt.Errorf("surveyor was not started with TLS enabled")
+	}
+	return s.tls.ReloadTLS()
+}
+
+// Stop shuts down the Surveyor, closing the NATS connection and the HTTP
+// listener.
+func (s *Surveyor) Stop() {
+	for _, obs := range s.observations {
+		obs.Stop()
+	}
+	if s.otlp != nil {
+		s.otlp.close()
+	}
+	if s.http != nil {
+		_ = s.http.Shutdown(context.Background())
+	}
+	if s.tls != nil {
+		s.tls.Close()
+	}
+	if s.nc != nil {
+		s.nc.Close()
+	}
+}
@@ -21,11 +21,15 @@ import (
 	"io/ioutil"
 	"log"
 	"net/http"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	st "github.com/nats-io/nats-surveyor/test"
+	"github.com/nats-io/nats.go"
 )
 
 // Testing constants
@@ -60,14 +64,34 @@ func httpGetSecure(url string) (*http.Response, error) {
 	return httpClient.Get(url)
 }
 
+// httpGetSecureNoClientCert is httpGetSecure without a client certificate,
+// used to assert that RequireAndVerifyClientCert actually rejects a
+// handshake that doesn't present one.
+func httpGetSecureNoClientCert(url string) (*http.Response, error) {
+	caCert, err := ioutil.ReadFile(caCertFile)
+	if err != nil {
+		return nil, fmt.Errorf("Got error reading RootCA file: %s", err)
+	}
+	caCertPool := x509.NewCertPool()
+	caCertPool.AppendCertsFromPEM(caCert)
+	transport := &http.Transport{TLSClientConfig: &tls.Config{RootCAs: caCertPool}}
+	httpClient := &http.Client{Transport: transport, Timeout: 30 * time.Second}
+	return httpClient.Get(url)
+}
+
 func httpGet(url string) (*http.Response, error) {
 	httpClient := &http.Client{Timeout: 30 * time.Second}
 	return httpClient.Get(url)
 }
 
+// getTestOptions returns default options against the test deployments in
+// the test package. NatsUser/NatsPassword authenticate into the $SYS
+// account on st.NewSuperCluster; st.StartBasicServer doesn't configure any
+// auth, so the same credentials are simply ignored there.
 func getTestOptions() *Options {
 	o := GetDefaultOptions()
-	o.Credentials = st.SystemCreds
+	o.NatsUser = st.SystemAccountUser
+	o.NatsPassword = st.SystemAccountPassword
 	o.ListenAddress = "127.0.0.1"
 	return o
 }
@@ -193,17 +217,19 @@ func TestSurveyor_Reconnect(t *testing.T) {
 	}
 
 	// poll and check for basic core NATS output, the next server should
-	for i := 0; i < 5; i++ {
+	// answer once the client reconnects, but nats_up may still read 0 for
+	// a round or two while the collector's expected count catches up with
+	// the smaller deployment, so keep polling until it reads 1.
+	up := false
+	for i := 0; i < 10; i++ {
 		output, err = pollAndCheck(t, defaultSurveyorURL, "nats_core_mem_bytes")
-		if err == nil {
+		if err == nil && strings.Contains(output, "nats_up 1") {
+			up = true
 			break
 		}
 		time.Sleep(1 * time.Second)
 	}
-	if err != nil {
-		t.Fatalf("Retries failed.")
-	}
-	if strings.Contains(output, "nats_up 1") == false {
+	if !up {
 		t.Fatalf("output did not contain nats-up 1")
 	}
 }
@@ -233,6 +259,231 @@ func TestSurveyor_NoSystemAccount(t *testing.T) {
 	}
 }
 
+func TestSurveyor_ServiceLatencyObservation(t *testing.T) {
+	ns := st.StartBasicServer()
+	defer ns.Shutdown()
+
+	opts := getTestOptions()
+	cfg := &ObservationConfig{Type: "service-latency", Name: "orders", Subject: "$SRV.LATENCY.>"}
+	obs, err := NewObservationFromConfig(cfg)
+	if err != nil {
+		t.Fatalf("couldn't build observation: %v", err)
+	}
+	opts.Observations = []Observation{obs}
+
+	s, err := NewSurveyor(opts)
+	if err != nil {
+		t.Fatalf("couldn't create surveyor: %v", err)
+	}
+	if err = s.Start(); err != nil {
+		t.Fatalf("start error: %v", err)
+	}
+	defer s.Stop()
+
+	nc, err := nats.Connect(opts.URLs)
+	if err != nil {
+		t.Fatalf("couldn't connect publisher: %v", err)
+	}
+	defer nc.Close()
+
+	if err := nc.Publish("$SRV.LATENCY.orders", []byte(`{"app":"checkout","start":"","total_latency":12.5}`)); err != nil {
+		t.Fatalf("couldn't publish latency sample: %v", err)
+	}
+	nc.Flush()
+
+	var output string
+	for i := 0; i < 5; i++ {
+		output, err = pollAndCheck(t, defaultSurveyorURL, "nats_service_latency_duration_seconds")
+		if err == nil {
+			break
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("observation metric never appeared: %v", err)
+	}
+	if !strings.Contains(output, `observation="orders"`) {
+		t.Fatalf("expected observation label on metric, got: %v", output)
+	}
+}
+
+func TestSurveyor_JetStreamObservation(t *testing.T) {
+	ns := st.StartJetStreamServer(t)
+	defer ns.Shutdown()
+
+	opts := getTestOptions()
+
+	nc, err := nats.Connect(opts.URLs, nats.UserInfo(st.AppAccountUser, st.AppAccountPassword))
+	if err != nil {
+		t.Fatalf("couldn't connect publisher: %v", err)
+	}
+	defer nc.Close()
+
+	js, err := nc.JetStream()
+	if err != nil {
+		t.Fatalf("couldn't get JetStream context: %v", err)
+	}
+	if _, err := js.AddStream(&nats.StreamConfig{Name: "ORDERS", Subjects: []string{"orders.>"}}); err != nil {
+		t.Fatalf("couldn't add stream: %v", err)
+	}
+	if _, err := js.Publish("orders.1", []byte("hello")); err != nil {
+		t.Fatalf("couldn't publish: %v", err)
+	}
+
+	// The jetstream observation only polls on an interval, starting with an
+	// immediate poll on Start, so the stream must exist beforehand for the
+	// metric to show up without waiting out jsPollInterval.
+	cfg := &ObservationConfig{Type: "jetstream", Name: "orders", Account: st.AppAccountName}
+	obs, err := NewObservationFromConfig(cfg)
+	if err != nil {
+		t.Fatalf("couldn't build observation: %v", err)
+	}
+	opts.Observations = []Observation{obs}
+
+	s, err := NewSurveyor(opts)
+	if err != nil {
+		t.Fatalf("couldn't create surveyor: %v", err)
+	}
+	if err = s.Start(); err != nil {
+		t.Fatalf("start error: %v", err)
+	}
+	defer s.Stop()
+
+	var output string
+	for i := 0; i < 5; i++ {
+		output, err = pollAndCheck(t, defaultSurveyorURL, "nats_stream_messages")
+		if err == nil {
+			break
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("observation metric never appeared: %v", err)
+	}
+	if !strings.Contains(output, `stream="ORDERS"`) {
+		t.Fatalf("expected stream label on metric, got: %v", output)
+	}
+	if !strings.Contains(output, "nats_stream_bytes") {
+		t.Fatalf("expected nats_stream_bytes metric, got: %v", output)
+	}
+}
+
+func TestSurveyor_JetStreamObservation_PrunesDeletedStreams(t *testing.T) {
+	ns := st.StartJetStreamServer(t)
+	defer ns.Shutdown()
+
+	opts := getTestOptions()
+
+	nc, err := nats.Connect(opts.URLs, nats.UserInfo(st.AppAccountUser, st.AppAccountPassword))
+	if err != nil {
+		t.Fatalf("couldn't connect publisher: %v", err)
+	}
+	defer nc.Close()
+
+	js, err := nc.JetStream()
+	if err != nil {
+		t.Fatalf("couldn't get JetStream context: %v", err)
+	}
+	if _, err := js.AddStream(&nats.StreamConfig{Name: "ORDERS", Subjects: []string{"orders.>"}}); err != nil {
+		t.Fatalf("couldn't add stream: %v", err)
+	}
+	if _, err := js.Publish("orders.1", []byte("hello")); err != nil {
+		t.Fatalf("couldn't publish: %v", err)
+	}
+
+	cfg := &ObservationConfig{Type: "jetstream", Name: "orders", Account: st.AppAccountName}
+	obs, err := NewObservationFromConfig(cfg)
+	if err != nil {
+		t.Fatalf("couldn't build observation: %v", err)
+	}
+	opts.Observations = []Observation{obs}
+
+	s, err := NewSurveyor(opts)
+	if err != nil {
+		t.Fatalf("couldn't create surveyor: %v", err)
+	}
+	if err = s.Start(); err != nil {
+		t.Fatalf("start error: %v", err)
+	}
+	defer s.Stop()
+
+	var output string
+	for i := 0; i < 5; i++ {
+		output, err = pollAndCheck(t, defaultSurveyorURL, `stream="ORDERS"`)
+		if err == nil {
+			break
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("observation metric never appeared: %v", err)
+	}
+
+	if err := js.DeleteStream("ORDERS"); err != nil {
+		t.Fatalf("couldn't delete stream: %v", err)
+	}
+
+	// Wait out a full jsPollInterval tick so the observation's own poll
+	// loop (not a manual call racing it) is what prunes the series.
+	deadline := time.Now().Add(jsPollInterval + 5*time.Second)
+	for {
+		output, err = PollSurveyorEndpoint(t, defaultSurveyorURL, false, http.StatusOK)
+		if err != nil {
+			t.Fatalf("couldn't scrape after stream deletion: %v", err)
+		}
+		if !strings.Contains(output, `stream="ORDERS"`) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected ORDERS series to be pruned after stream deletion, got: %v", output)
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+func TestSurveyor_ConnzObservation(t *testing.T) {
+	sc := st.NewSuperCluster(t)
+	defer sc.Shutdown()
+
+	opts := getTestOptions()
+	cfg := &ObservationConfig{Type: "connz", Name: "sys", Account: "$SYS"}
+	obs, err := NewObservationFromConfig(cfg)
+	if err != nil {
+		t.Fatalf("couldn't build observation: %v", err)
+	}
+	opts.Observations = []Observation{obs}
+
+	s, err := NewSurveyor(opts)
+	if err != nil {
+		t.Fatalf("couldn't create surveyor: %v", err)
+	}
+	if err = s.Start(); err != nil {
+		t.Fatalf("start error: %v", err)
+	}
+	defer s.Stop()
+
+	nc, err := nats.Connect(opts.URLs, nats.UserInfo(st.SystemAccountUser, st.SystemAccountPassword))
+	if err != nil {
+		t.Fatalf("couldn't connect client: %v", err)
+	}
+	defer nc.Close()
+
+	var output string
+	for i := 0; i < 5; i++ {
+		output, err = pollAndCheck(t, defaultSurveyorURL, "nats_account_connections")
+		if err == nil {
+			break
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("observation metric never appeared: %v", err)
+	}
+	if !strings.Contains(output, `account="$SYS"`) {
+		t.Fatalf("expected account label on metric, got: %v", output)
+	}
+}
+
 func TestSurveyor_HTTPS(t *testing.T) {
 	sc := st.NewSuperCluster(t)
 	defer sc.Shutdown()
@@ -261,6 +512,108 @@ func TestSurveyor_HTTPS(t *testing.T) {
 	}
 }
 
+func TestSurveyor_HTTPS_ClientCAFilesDirectory(t *testing.T) {
+	sc := st.NewSuperCluster(t)
+	defer sc.Shutdown()
+
+	dir := t.TempDir()
+	caPEM, err := ioutil.ReadFile(caCertFile)
+	if err != nil {
+		t.Fatalf("couldn't read CA file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "ca.pem"), caPEM, 0600); err != nil {
+		t.Fatalf("couldn't write CA file into directory: %v", err)
+	}
+
+	opts := getTestOptions()
+	opts.ClientCAFiles = []string{dir}
+	opts.CertFile = serverCert
+	opts.KeyFile = serverKey
+
+	s, err := NewSurveyor(opts)
+	if err != nil {
+		t.Fatalf("couldn't create surveyor: %v", err)
+	}
+	if err = s.Start(); err != nil {
+		t.Fatalf("start error: %v", err)
+	}
+	defer s.Stop()
+
+	// A client presenting a cert signed by the CA in the directory is let
+	// in.
+	if _, err = PollSurveyorEndpoint(t, "https://127.0.0.1:7777/metrics", true, http.StatusOK); err != nil {
+		t.Fatalf("received unexpected error: %v", err)
+	}
+	// RequireAndVerifyClientCert rejects a handshake with no client cert
+	// at all.
+	if _, err = httpGetSecureNoClientCert("https://127.0.0.1:7777/metrics"); err == nil {
+		t.Fatalf("expected handshake without a client cert to fail")
+	}
+}
+
+func TestSurveyor_HTTPS_ClientCAFilesMultipleEntries(t *testing.T) {
+	sc := st.NewSuperCluster(t)
+	defer sc.Shutdown()
+
+	// Two entries pointing at copies of the same CA, standing in for a
+	// cross-signed root or a staged CA migration, check that a list of
+	// several CA files loads and still verifies the client cert. Both
+	// entries hold the same CA, so this does not tell a pool built from
+	// every entry apart from one built from a single entry.
+	dir := t.TempDir()
+	caPEM, err := ioutil.ReadFile(caCertFile)
+	if err != nil {
+		t.Fatalf("couldn't read CA file: %v", err)
+	}
+	secondCA := filepath.Join(dir, "ca-copy.pem")
+	if err := os.WriteFile(secondCA, caPEM, 0600); err != nil {
+		t.Fatalf("couldn't write second CA file: %v", err)
+	}
+
+	opts := getTestOptions()
+	opts.ClientCAFiles = []string{caCertFile, secondCA}
+	opts.CertFile = serverCert
+	opts.KeyFile = serverKey
+
+	s, err := NewSurveyor(opts)
+	if err != nil {
+		t.Fatalf("couldn't create surveyor: %v", err)
+	}
+	if err = s.Start(); err != nil {
+		t.Fatalf("start error: %v", err)
+	}
+	defer s.Stop()
+
+	if _, err = PollSurveyorEndpoint(t, "https://127.0.0.1:7777/metrics", true, http.StatusOK); err != nil {
+		t.Fatalf("received unexpected error: %v", err)
+	}
+	if _, err = httpGetSecureNoClientCert("https://127.0.0.1:7777/metrics"); err == nil {
+		t.Fatalf("expected handshake without a client cert to fail")
+	}
+}
+
+func TestSurveyor_RootCAFiles(t *testing.T) {
+	ns := st.StartTLSServer(t, serverCert, serverKey)
+	defer ns.Shutdown()
+
+	opts := getTestOptions()
+	opts.RootCAFiles = []string{caCertFile}
+	opts.URLs = "tls://127.0.0.1:4222"
+
+	s, err := NewSurveyor(opts)
+	if err != nil {
+		t.Fatalf("couldn't create surveyor: %v", err)
+	}
+	if err = s.Start(); err != nil {
+		t.Fatalf("start error: %v", err)
+	}
+	defer s.Stop()
+
+	if _, err = pollAndCheck(t, defaultSurveyorURL, "nats_core_mem_bytes"); err != nil {
+		t.Fatalf("received unexpected error: %v", err)
+	}
+}
+
 func TestSurveyor_UserPass(t *testing.T) {
 	ns := st.StartBasicServer()
 	defer ns.Shutdown()
@@ -327,8 +680,61 @@ func TestSurveyor_MissingResponses(t *testing.T) {
 	sc.Servers[1].Shutdown()
 
 	// poll and check for basic core NATS output
-	_, err = pollAndCheck(t, defaultSurveyorURL, "nats_core_mem_bytes")
+	output, err := pollAndCheck(t, defaultSurveyorURL, "nats_core_mem_bytes")
 	if err != nil {
 		t.Fatalf("poll error:  %v\n", err)
 	}
+
+	// the poll should have surfaced sizing metrics even though one of
+	// the four servers never replied
+	for _, metric := range []string{
+		"nats_surveyor_poll_duration_seconds",
+		"nats_surveyor_expected_servers",
+		"nats_surveyor_received_servers",
+	} {
+		if !strings.Contains(output, metric) {
+			t.Fatalf("expected %s in output", metric)
+		}
+	}
+}
+
+func TestSurveyor_ConcurrentPollServesCache(t *testing.T) {
+	sc := st.NewSuperCluster(t)
+	defer sc.Shutdown()
+
+	opts := getTestOptions()
+	opts.PollWorkers = 2
+	s, err := NewSurveyor(opts)
+	if err != nil {
+		t.Fatalf("couldn't create surveyor: %v", err)
+	}
+	if err = s.Start(); err != nil {
+		t.Fatalf("start error: %v", err)
+	}
+	defer s.Stop()
+
+	// warm the cache with one successful poll
+	if _, err := pollAndCheck(t, defaultSurveyorURL, "nats_core_mem_bytes"); err != nil {
+		t.Fatalf("poll error: %v", err)
+	}
+
+	// two scrapes fired back to back should both succeed: the second
+	// should be served from the cached statz rather than blocking behind
+	// the first poll.
+	var wg sync.WaitGroup
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := pollAndCheck(t, defaultSurveyorURL, "nats_core_mem_bytes"); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("concurrent poll error: %v", err)
+	}
 }
@@ -0,0 +1,203 @@
+// Copyright 2019 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package surveyor
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"path/filepath"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// tlsReloader keeps the HTTPS listener's server keypair and client CA pool
+// in sync with the files on disk, so certificates can be rotated without
+// restarting the surveyor. For a caFiles entry that is a directory, the
+// watch sees the directory as an entry of its parent, not the files inside
+// it: changing a PEM file in that directory does not trigger a reload,
+// though any reload (ReloadTLS, or a change to a watched file) reads it.
+type tlsReloader struct {
+	mu sync.RWMutex
+
+	certFile string
+	keyFile  string
+	caFiles  []string
+	watched  map[string]bool // certFile/keyFile/caFiles, for filtering directory watch events
+	logger   Logger
+
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+
+	expiry  prometheus.Gauge
+	watcher *fsnotify.Watcher
+	done    chan struct{}
+}
+
+// newTLSReloader loads the initial keypair (and, if configured, the client
+// CA bundle) and starts watching the underlying files for changes.
+func newTLSReloader(o *Options, logger Logger) (*tlsReloader, error) {
+	caFiles := o.ClientCAFiles
+	if len(caFiles) == 0 && o.CaFile != "" {
+		caFiles = []string{o.CaFile}
+	}
+
+	r := &tlsReloader{
+		certFile: o.CertFile,
+		keyFile:  o.KeyFile,
+		caFiles:  caFiles,
+		logger:   logger,
+		done:     make(chan struct{}),
+		expiry: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "nats_surveyor_tls_cert_expiry_seconds",
+			Help: "Unix timestamp (seconds) at which the surveyor's current TLS server certificate expires.",
+		}),
+	}
+
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("could not start TLS file watcher: %v", err)
+	}
+
+	// Watch the parent directories rather than the files themselves:
+	// rotation tooling (cert-manager, acme clients, k8s secret remounts)
+	// typically replaces a cert by renaming a new file over the old one,
+	// which fires IN_MOVE_SELF/IN_DELETE_SELF against a watch on the old
+	// inode and detaches it for good. A directory watch keeps working
+	// across that rename.
+	r.watched = make(map[string]bool)
+	dirs := make(map[string]bool)
+	for _, f := range append([]string{r.certFile, r.keyFile}, r.caFiles...) {
+		if f == "" {
+			continue
+		}
+		r.watched[filepath.Clean(f)] = true
+		dirs[filepath.Dir(f)] = true
+	}
+	for d := range dirs {
+		if err := watcher.Add(d); err != nil {
+			watcher.Close()
+			return nil, fmt.Errorf("could not watch %q: %v", d, err)
+		}
+	}
+	r.watcher = watcher
+	go r.watch()
+
+	return r, nil
+}
+
+func (r *tlsReloader) watch() {
+	for {
+		select {
+		case <-r.done:
+			return
+		case event, ok := <-r.watcher.Events:
+			if !ok {
+				return
+			}
+			if !r.watched[filepath.Clean(event.Name)] {
+				continue
+			}
+			if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) == 0 {
+				continue
+			}
+			if err := r.reload(); err != nil {
+				r.logger.Errorf("TLS reload failed: %v", err)
+			} else {
+				r.logger.Noticef("reloaded TLS material from disk")
+			}
+		case err, ok := <-r.watcher.Errors:
+			if !ok {
+				return
+			}
+			r.logger.Errorf("TLS watcher error: %v", err)
+		}
+	}
+}
+
+// ReloadTLS re-reads the server keypair and CA bundle from disk and swaps
+// them into the running HTTPS listener. It can be called directly (e.g. in
+// response to SIGHUP) in addition to the automatic fsnotify-driven reload.
+func (r *tlsReloader) ReloadTLS() error {
+	return r.reload()
+}
+
+func (r *tlsReloader) reload() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("could not load server keypair: %v", err)
+	}
+
+	var pool *x509.CertPool
+	if len(r.caFiles) > 0 {
+		pool, err = loadCertPoolFromFiles(r.caFiles)
+		if err != nil {
+			return err
+		}
+	}
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return fmt.Errorf("could not parse server certificate: %v", err)
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.clientCAs = pool
+	r.mu.Unlock()
+
+	r.expiry.Set(float64(leaf.NotAfter.Unix()))
+	return nil
+}
+
+// GetCertificate implements the signature expected by tls.Config.GetCertificate,
+// always returning the most recently loaded server keypair.
+func (r *tlsReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// GetConfigForClient implements the signature expected by
+// tls.Config.GetConfigForClient, returning a config built from the most
+// recently loaded keypair and client CA pool.
+func (r *tlsReloader) GetConfigForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	r.mu.RLock()
+	pool := r.clientCAs
+	r.mu.RUnlock()
+
+	cfg := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: r.GetCertificate,
+	}
+	if pool != nil {
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return cfg, nil
+}
+
+// Close stops the background file watcher.
+func (r *tlsReloader) Close() {
+	close(r.done)
+	if r.watcher != nil {
+		r.watcher.Close()
+	}
+}
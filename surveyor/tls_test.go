@@ -0,0 +1,129 @@
+// Copyright 2019 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package surveyor
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// writeSelfSignedCert writes a freshly generated self-signed keypair to
+// certPath/keyPath, expiring at notAfter, for exercising tlsReloader
+// without depending on the static fixtures under test/certs.
+func writeSelfSignedCert(t *testing.T, certPath, keyPath string, notAfter time.Time) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("couldn't generate key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "surveyor-test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("couldn't create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("couldn't marshal key: %v", err)
+	}
+
+	// Write to temp files and rename into place, the way rotation tooling
+	// (cert-manager, acme clients, k8s secret remounts) does it, so the
+	// test exercises the same IN_MOVED_TO path the directory watch relies
+	// on instead of an in-place write.
+	writeThenRename(t, certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	writeThenRename(t, keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+}
+
+func writeThenRename(t *testing.T, path string, data []byte) {
+	t.Helper()
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		t.Fatalf("couldn't write %q: %v", tmp, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatalf("couldn't rename %q to %q: %v", tmp, path, err)
+	}
+}
+
+func TestTLSReloader_PicksUpRotatedCertificate(t *testing.T) {
+	dir := t.TempDir()
+	certPath := filepath.Join(dir, "server-cert.pem")
+	keyPath := filepath.Join(dir, "server-key.pem")
+
+	firstExpiry := time.Now().Add(24 * time.Hour)
+	writeSelfSignedCert(t, certPath, keyPath, firstExpiry)
+
+	opts := GetDefaultOptions()
+	opts.CertFile = certPath
+	opts.KeyFile = keyPath
+
+	r, err := newTLSReloader(opts, newDefaultLogger())
+	if err != nil {
+		t.Fatalf("couldn't create TLS reloader: %v", err)
+	}
+	defer r.Close()
+
+	cert, err := r.GetCertificate(nil)
+	if err != nil {
+		t.Fatalf("GetCertificate error: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatalf("couldn't parse leaf: %v", err)
+	}
+	if !leaf.NotAfter.Equal(firstExpiry.Truncate(time.Second)) {
+		t.Fatalf("initial cert expiry = %v, want %v", leaf.NotAfter, firstExpiry)
+	}
+
+	secondExpiry := time.Now().Add(48 * time.Hour)
+	writeSelfSignedCert(t, certPath, keyPath, secondExpiry)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		cert, err = r.GetCertificate(nil)
+		if err == nil {
+			if leaf, err = x509.ParseCertificate(cert.Certificate[0]); err == nil {
+				if leaf.NotAfter.Equal(secondExpiry.Truncate(time.Second)) {
+					break
+				}
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("rotated cert was not picked up in time (last expiry seen: %v)", leaf.NotAfter)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	if gaugeValue := testutil.ToFloat64(r.expiry); int64(gaugeValue) != secondExpiry.Unix() {
+		t.Fatalf("expiry gauge = %v, want %v", gaugeValue, secondExpiry.Unix())
+	}
+}
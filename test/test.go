@@ -0,0 +1,234 @@
+// Copyright 2019 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package test provides helpers for spinning up NATS server topologies used
+// by the surveyor package's tests.
+package test
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	gnatsd "github.com/nats-io/nats-server/v2/test"
+)
+
+// SuperCluster is a small multi-server, multi-cluster, multi-gateway NATS
+// deployment used to exercise the surveyor end to end.
+type SuperCluster struct {
+	Servers []*server.Server
+}
+
+// freePort asks the kernel for an unused TCP port by binding to port 0 and
+// immediately closing the listener, so the topology below can wire up
+// routes and gateways before any of the servers that own those ports exist.
+func freePort() int {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+// SystemAccountUser and SystemAccountPassword authenticate the surveyor
+// against the $SYS account on the test deployments below. A real client
+// identity is required here because $SYS.REQ.SERVER.PING only replies to
+// connections authenticated into the system account.
+const (
+	SystemAccountUser     = "sys"
+	SystemAccountPassword = "sys"
+)
+
+// sysAccountOptions returns test options with the $SYS account registered
+// and selected as the system account, along with a user that authenticates
+// into it, so $SYS.REQ.SERVER.PING (and the rest of the surveyor's
+// system-account traffic) resolves instead of panicking.
+func sysAccountOptions() *server.Options {
+	opts := gnatsd.DefaultTestOptions
+	opts.Port = -1
+	sysAcc := server.NewAccount("$SYS")
+	opts.Accounts = []*server.Account{sysAcc}
+	opts.Users = []*server.User{
+		{Username: SystemAccountUser, Password: SystemAccountPassword, Account: sysAcc},
+	}
+	opts.SystemAccount = "$SYS"
+	return &opts
+}
+
+func gatewayURL(port int) *url.URL {
+	return &url.URL{Scheme: "nats", Host: fmt.Sprintf("127.0.0.1:%d", port)}
+}
+
+// NewSuperCluster starts a small supercluster (two clusters of two servers
+// each, gatewayed together) with a system account enabled. The surveyor
+// connects to the one server listening on the default client port; statz
+// for every server flow back over the routes and gateway since they all
+// share the same system account.
+func NewSuperCluster(t *testing.T) *SuperCluster {
+	t.Helper()
+
+	clusterAPort, clusterBPort := freePort(), freePort()
+	gatewayAPort, gatewayBPort := freePort(), freePort()
+
+	entry := sysAccountOptions()
+	entry.Port = 4222
+	entry.Cluster.Name = "cluster-a"
+	entry.Cluster.Host = "127.0.0.1"
+	entry.Cluster.Port = clusterAPort
+	entry.Gateway.Name = "cluster-a"
+	entry.Gateway.Host = "127.0.0.1"
+	entry.Gateway.Port = gatewayAPort
+	entry.Gateway.Gateways = []*server.RemoteGatewayOpts{
+		{Name: "cluster-b", URLs: []*url.URL{gatewayURL(gatewayBPort)}},
+	}
+	a0 := gnatsd.RunServer(entry)
+
+	a1opts := sysAccountOptions()
+	a1opts.Cluster.Name = "cluster-a"
+	a1opts.Cluster.Host = "127.0.0.1"
+	a1opts.Cluster.Port = -1
+	a1opts.Routes = server.RoutesFromStr(fmt.Sprintf("nats://127.0.0.1:%d", clusterAPort))
+	a1opts.Gateway.Name = "cluster-a"
+	a1opts.Gateway.Host = "127.0.0.1"
+	a1opts.Gateway.Port = -1
+	a1 := gnatsd.RunServer(a1opts)
+
+	b0opts := sysAccountOptions()
+	b0opts.Cluster.Name = "cluster-b"
+	b0opts.Cluster.Host = "127.0.0.1"
+	b0opts.Cluster.Port = clusterBPort
+	b0opts.Gateway.Name = "cluster-b"
+	b0opts.Gateway.Host = "127.0.0.1"
+	b0opts.Gateway.Port = gatewayBPort
+	b0 := gnatsd.RunServer(b0opts)
+
+	b1opts := sysAccountOptions()
+	b1opts.Cluster.Name = "cluster-b"
+	b1opts.Cluster.Host = "127.0.0.1"
+	b1opts.Cluster.Port = -1
+	b1opts.Routes = server.RoutesFromStr(fmt.Sprintf("nats://127.0.0.1:%d", clusterBPort))
+	b1opts.Gateway.Name = "cluster-b"
+	b1opts.Gateway.Host = "127.0.0.1"
+	b1opts.Gateway.Port = -1
+	b1 := gnatsd.RunServer(b1opts)
+
+	servers := []*server.Server{a0, a1, b0, b1}
+	sc := &SuperCluster{Servers: servers}
+	sc.waitForConnectivity(t)
+	return sc
+}
+
+// waitForConnectivity blocks until every server has a route to its
+// clustermate and the gateway between cluster-a and cluster-b is up, so
+// tests that poll for statz immediately after NewSuperCluster returns don't
+// race the topology settling.
+func (sc *SuperCluster) waitForConnectivity(t *testing.T) {
+	t.Helper()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		ready := true
+		for _, s := range sc.Servers {
+			if s.NumRoutes() < 1 {
+				ready = false
+				break
+			}
+			gwz, err := s.Gatewayz(nil)
+			if err != nil || len(gwz.OutboundGateways) < 1 {
+				ready = false
+				break
+			}
+		}
+		if ready {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatalf("supercluster did not establish routes/gateways in time")
+}
+
+// Shutdown stops every server in the supercluster.
+func (sc *SuperCluster) Shutdown() {
+	for _, s := range sc.Servers {
+		s.Shutdown()
+	}
+}
+
+// StartBasicServer starts a single NATS server with no system account
+// configured, used to test surveyor's behavior against a plain deployment.
+func StartBasicServer() *server.Server {
+	opts := gnatsd.DefaultTestOptions
+	opts.Port = 4222
+	return gnatsd.RunServer(&opts)
+}
+
+// StartTLSServer starts a single NATS server with a system account and
+// TLS enabled on the client port using certFile/keyFile, used to test
+// Options.RootCAFiles against a real TLS-secured NATS connection.
+func StartTLSServer(t *testing.T, certFile, keyFile string) *server.Server {
+	t.Helper()
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("couldn't load server keypair: %v", err)
+	}
+
+	opts := sysAccountOptions()
+	opts.Port = 4222
+	opts.TLSConfig = &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	return gnatsd.RunServer(opts)
+}
+
+// AppAccountUser and AppAccountPassword authenticate into the JetStream-
+// enabled "APP" account on StartJetStreamServer, the account observed by
+// the jetstream observation's tests.
+const (
+	AppAccountUser     = "app"
+	AppAccountPassword = "app"
+	AppAccountName     = "APP"
+)
+
+// StartJetStreamServer starts a single NATS server with a system account
+// plus a JetStream-enabled "APP" account, used to test the jetstream
+// observation. JetStream can't be enabled on the system account
+// itself, so stream traffic has to live in a second account.
+func StartJetStreamServer(t *testing.T) *server.Server {
+	t.Helper()
+
+	opts := sysAccountOptions()
+	opts.Port = 4222
+	opts.JetStream = true
+	opts.StoreDir = t.TempDir()
+
+	appAcc := server.NewAccount(AppAccountName)
+	opts.Accounts = append(opts.Accounts, appAcc)
+	opts.Users = append(opts.Users, &server.User{Username: AppAccountUser, Password: AppAccountPassword, Account: appAcc})
+
+	s := gnatsd.RunServer(opts)
+	acc, err := s.LookupAccount(AppAccountName)
+	if err != nil {
+		t.Fatalf("couldn't look up %q account: %v", AppAccountName, err)
+	}
+	if err := acc.EnableJetStream(nil); err != nil {
+		t.Fatalf("couldn't enable JetStream on %q account: %v", AppAccountName, err)
+	}
+	return s
+}